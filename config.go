@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config controls which container images and commands sessions may run, the
+// resource limits applied to each container, and how many concurrent
+// sessions a client may hold open.
+type Config struct {
+	AllowedImages []string `yaml:"allowed_images"`
+	DefaultImage  string   `yaml:"default_image"`
+	DefaultCmd    []string `yaml:"default_cmd"`
+
+	Resources ResourceLimits `yaml:"resources"`
+
+	SessionIdleTTL     time.Duration `yaml:"session_idle_ttl"`
+	MaxSessionDuration time.Duration `yaml:"max_session_duration"`
+	MaxSessionsPerIP   int           `yaml:"max_sessions_per_ip"`
+
+	// TrustProxyHeaders makes the per-IP limiter honor X-Forwarded-For.
+	// Only enable this when termigo sits behind a proxy that sets the header
+	// (overwriting or appending to it); otherwise any client can forge it to
+	// dodge MaxSessionsPerIP.
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers"`
+
+	RecordingsEnabled   bool   `yaml:"recordings_enabled"`
+	RecordingsDir       string `yaml:"recordings_dir"`
+	RecordingsRetention int    `yaml:"recordings_retention"`
+}
+
+// ResourceLimits mirrors the subset of container.HostConfig termigo
+// constrains every session with, so a session can't starve the host.
+type ResourceLimits struct {
+	MemoryBytes int64 `yaml:"memory_bytes"`
+	NanoCPUs    int64 `yaml:"nano_cpus"`
+	PidsLimit   int64 `yaml:"pids_limit"`
+}
+
+// DefaultConfig returns the configuration termigo ships with: a single
+// locked-down alpine shell, generous enough to demo but safe to expose
+// beyond localhost.
+func DefaultConfig() *Config {
+	return &Config{
+		AllowedImages: []string{alpine},
+		DefaultImage:  alpine,
+		DefaultCmd:    []string{initialCmd},
+		Resources: ResourceLimits{
+			MemoryBytes: 128 * 1024 * 1024,
+			NanoCPUs:    500_000_000,
+			PidsLimit:   64,
+		},
+		SessionIdleTTL:     5 * time.Minute,
+		MaxSessionDuration: 30 * time.Minute,
+		MaxSessionsPerIP:   2,
+		TrustProxyHeaders:  false,
+
+		RecordingsEnabled:   false,
+		RecordingsDir:       "recordings",
+		RecordingsRetention: 100,
+	}
+}
+
+// LoadConfig reads a YAML config file at path, falling back to
+// DefaultConfig if path is empty or does not exist, then applies
+// TERMIGO_*-prefixed environment variable overrides.
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("error parsing config %s: %w", path, err)
+			}
+		case os.IsNotExist(err):
+			// no config file: stick with defaults and env overrides
+		default:
+			return nil, fmt.Errorf("error reading config %s: %w", path, err)
+		}
+	}
+
+	applyEnvOverrides(cfg)
+	return cfg, nil
+}
+
+func applyEnvOverrides(cfg *Config) {
+	if v := os.Getenv("TERMIGO_DEFAULT_IMAGE"); v != "" {
+		cfg.DefaultImage = v
+	}
+	if v := os.Getenv("TERMIGO_MAX_SESSIONS_PER_IP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.MaxSessionsPerIP = n
+		}
+	}
+}
+
+// allowsImage reports whether image is in the configured allow-list.
+func (c *Config) allowsImage(image string) bool {
+	for _, allowed := range c.AllowedImages {
+		if allowed == image {
+			return true
+		}
+	}
+	return false
+}
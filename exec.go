@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gorilla/websocket"
+)
+
+// execFrame is the server->client framing used in mode=exec, distinguishing
+// stdout from stderr so a frontend can color them, with a final "exit"
+// frame carrying the command's exit code.
+type execFrame struct {
+	Stream string `json:"stream"` // "stdout", "stderr", or "exit"
+	Data   string `json:"data,omitempty"`
+	Code   *int   `json:"code,omitempty"` // set only on "exit" frames, including code 0
+}
+
+// execCommand is the client->server request in mode=exec: one command and
+// its arguments to run to completion in the session container.
+type execCommand struct {
+	Cmd []string `json:"cmd"`
+}
+
+// handleExecWebSocket runs one-shot, non-interactive commands in a
+// container started with Tty:false, demultiplexing stdout/stderr via
+// stdcopy instead of merging them the way the TTY path does. Each incoming
+// text frame is decoded as an execCommand and run to completion before the
+// next is read. All outgoing frames go through cw so they never race with
+// its keepalive pings.
+func handleExecWebSocket(ctx context.Context, cli *client.Client, cfg *Config, conn *websocket.Conn, cw *connWriter, r *http.Request) {
+	image := r.URL.Query().Get("image")
+	if image == "" {
+		image = cfg.DefaultImage
+	}
+	if !cfg.allowsImage(image) {
+		cw.Send(websocket.TextMessage, []byte(fmt.Sprintf("image %q is not in the allowed list", image)))
+		return
+	}
+
+	containerID, err := startExecContainer(ctx, cli, cfg, image)
+	if err != nil {
+		cw.Send(websocket.TextMessage, []byte(fmt.Sprintf("error starting container: %v", err)))
+		return
+	}
+	defer stopAndRemoveContainer(ctx, cli, containerID)
+
+	// Exec containers aren't registered with SessionManager, so without a
+	// watchdog of their own they'd be exempt from SessionIdleTTL and
+	// MaxSessionDuration, bounded only by the per-IP connection limiter.
+	watchdog := newExecWatchdog(cfg)
+	watchdogCtx, cancelWatchdog := context.WithCancel(ctx)
+	defer cancelWatchdog()
+	go watchdog.run(watchdogCtx, cw)
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("websocket read error: %v", err)
+			return
+		}
+		watchdog.touch()
+
+		var cmd execCommand
+		if err := json.Unmarshal(message, &cmd); err != nil || len(cmd.Cmd) == 0 {
+			log.Printf("error decoding exec command: %v", err)
+			continue
+		}
+
+		if err := runExec(ctx, cli, containerID, cmd.Cmd, cw); err != nil {
+			log.Printf("error running exec command: %v", err)
+			return
+		}
+	}
+}
+
+// execWatchdog enforces the same MaxSessionDuration/SessionIdleTTL limits
+// SessionManager's janitor applies to TTY sessions, since mode=exec
+// containers aren't registered with it and would otherwise be held open
+// indefinitely as long as the client keeps answering keepalive pings.
+type execWatchdog struct {
+	cfg       *Config
+	startedAt time.Time
+
+	mu           sync.Mutex
+	lastActivity time.Time
+}
+
+func newExecWatchdog(cfg *Config) *execWatchdog {
+	now := time.Now()
+	return &execWatchdog{cfg: cfg, startedAt: now, lastActivity: now}
+}
+
+// touch records that a command was just received, postponing idle expiry.
+func (w *execWatchdog) touch() {
+	w.mu.Lock()
+	w.lastActivity = time.Now()
+	w.mu.Unlock()
+}
+
+func (w *execWatchdog) expired() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	idle := w.cfg.SessionIdleTTL > 0 && now.Sub(w.lastActivity) > w.cfg.SessionIdleTTL
+	overLifetime := w.cfg.MaxSessionDuration > 0 && now.Sub(w.startedAt) > w.cfg.MaxSessionDuration
+	return idle || overLifetime
+}
+
+// run polls at the same cadence janitorInterval computes for TTY sessions
+// and closes cw as soon as the watchdog detects expiry, which unblocks the
+// exec loop's conn.ReadMessage call and ends the connection. It returns
+// early if ctx is cancelled (the connection is already closing) or if both
+// limits are disabled.
+func (w *execWatchdog) run(ctx context.Context, cw *connWriter) {
+	interval := janitorInterval(w.cfg.SessionIdleTTL, w.cfg.MaxSessionDuration)
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if w.expired() {
+				cw.Close()
+				return
+			}
+		}
+	}
+}
+
+// startExecContainer starts a long-lived, non-TTY container that exec
+// commands are run against, under the same resource limits as TTY sessions.
+func startExecContainer(ctx context.Context, cli *client.Client, cfg *Config, image string) (string, error) {
+	containerCfg := &container.Config{
+		Image: image,
+		Cmd:   []string{"sleep", "infinity"},
+		Tty:   false,
+	}
+	hostCfg := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:    cfg.Resources.MemoryBytes,
+			NanoCPUs:  cfg.Resources.NanoCPUs,
+			PidsLimit: &cfg.Resources.PidsLimit,
+		},
+		CapDrop:        []string{"ALL"},
+		ReadonlyRootfs: true,
+		NetworkMode:    "none",
+		SecurityOpt:    []string{"no-new-privileges"},
+		Tmpfs:          map[string]string{"/tmp": "rw,noexec,nosuid,size=64m"},
+	}
+
+	resp, err := cli.ContainerCreate(ctx, containerCfg, hostCfg, nil, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("error creating exec container: %w", err)
+	}
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", fmt.Errorf("error starting exec container: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// runExec runs cmd to completion inside containerID, demultiplexing
+// stdout/stderr to the websocket as they arrive, then sends a final "exit"
+// frame with the command's exit code.
+func runExec(ctx context.Context, cli *client.Client, containerID string, cmd []string, cw *connWriter) error {
+	exec, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating exec: %w", err)
+	}
+
+	attach, err := cli.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return fmt.Errorf("error attaching to exec: %w", err)
+	}
+	defer attach.Close()
+
+	stdout := execFrameWriter{cw: cw, stream: "stdout"}
+	stderr := execFrameWriter{cw: cw, stream: "stderr"}
+	if _, err := stdcopy.StdCopy(stdout, stderr, attach.Reader); err != nil {
+		return fmt.Errorf("error demultiplexing exec output: %w", err)
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return fmt.Errorf("error inspecting exec: %w", err)
+	}
+
+	exitFrame, err := json.Marshal(execFrame{Stream: "exit", Code: &inspect.ExitCode})
+	if err != nil {
+		return err
+	}
+	cw.Send(websocket.TextMessage, exitFrame)
+	return nil
+}
+
+// execFrameWriter adapts a connWriter to io.Writer, wrapping each write in
+// an execFrame JSON text message tagged with its stream.
+type execFrameWriter struct {
+	cw     *connWriter
+	stream string
+}
+
+func (w execFrameWriter) Write(p []byte) (int, error) {
+	frame, err := json.Marshal(execFrame{Stream: w.stream, Data: string(p)})
+	if err != nil {
+		return 0, err
+	}
+	w.cw.Send(websocket.TextMessage, frame)
+	return len(p), nil
+}
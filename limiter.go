@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ipLimiter enforces a per-client-IP cap on concurrent sessions using a
+// sync.Map of atomic counters, so concurrent connections never race on a
+// shared counter.
+type ipLimiter struct {
+	max    int
+	counts sync.Map // ip string -> *int64
+}
+
+func newIPLimiter(max int) *ipLimiter {
+	return &ipLimiter{max: max}
+}
+
+// Acquire increments ip's counter and reports whether it was still within
+// the limit. On success, the caller must call Release exactly once when
+// done; on failure, no slot was taken and Release must not be called.
+func (l *ipLimiter) Acquire(ip string) bool {
+	v, _ := l.counts.LoadOrStore(ip, new(int64))
+	counter := v.(*int64)
+	if atomic.AddInt64(counter, 1) > int64(l.max) {
+		atomic.AddInt64(counter, -1)
+		return false
+	}
+	return true
+}
+
+// Release gives back a slot acquired for ip.
+func (l *ipLimiter) Release(ip string) {
+	v, ok := l.counts.Load(ip)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(v.(*int64), -1)
+}
+
+// clientIP extracts the caller's address for rate limiting purposes. It only
+// honors a proxy-set X-Forwarded-For header when trustProxy is true: termigo
+// sits directly on the internet by default, so trusting a client-supplied
+// header there would let anyone forge a fresh identity per request and
+// bypass ipLimiter entirely. Set trustProxy (cfg.TrustProxyHeaders) only
+// when termigo is deployed behind a proxy that sets the header, by
+// overwriting it or appending to it.
+//
+// Proxies conventionally append to X-Forwarded-For rather than replace it
+// (nginx's $proxy_add_x_forwarded_for, Traefik, ALBs), so the header may
+// read "<client-supplied>, <real-client-ip>". We take the rightmost entry —
+// the one our own proxy appended — since anything to its left is still
+// attacker-controlled.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,14 +1,13 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 
@@ -18,9 +17,11 @@ import (
 )
 
 const (
-	alpine     = "alpine:latest"
-	initialCmd = "sh"
-	wsRoute    = "/terminal"
+	alpine      = "alpine:latest"
+	initialCmd  = "sh"
+	wsRoute     = "/terminal"
+	defaultCols = 80
+	defaultRows = 24
 )
 
 var (
@@ -29,10 +30,21 @@ var (
 		WriteBufferSize: 1024,
 		CheckOrigin:     func(r *http.Request) bool { return true },
 	}
-	maxConnections = 3
 	activeSessions = sync.WaitGroup{}
 )
 
+// controlMessage is the JSON framing used for client->server control and
+// input frames sent as websocket.TextMessage, and for server->client
+// notifications such as the assigned session ID. Raw terminal input may
+// also be sent as websocket.BinaryMessage and is forwarded to the
+// container stdin verbatim.
+type controlMessage struct {
+	Type string `json:"type"`
+	Cols uint   `json:"cols,omitempty"`
+	Rows uint   `json:"rows,omitempty"`
+	Data string `json:"data,omitempty"`
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -43,9 +55,19 @@ func main() {
 	}
 	defer cli.Close()
 
+	cfg, err := LoadConfig(os.Getenv("TERMIGO_CONFIG_PATH"))
+	if err != nil {
+		log.Fatalf("error loading config: %v", err)
+	}
+
+	sessions := NewSessionManager(ctx, cli, cfg)
+	limiter := newIPLimiter(cfg.MaxSessionsPerIP)
+
 	http.HandleFunc(wsRoute, func(w http.ResponseWriter, r *http.Request) {
-		handleWebSocket(ctx, cli, w, r)
+		handleWebSocket(ctx, cli, cfg, sessions, limiter, w, r)
 	})
+	http.HandleFunc("/recordings", handleListRecordings(cfg))
+	http.HandleFunc("/recordings/", handleGetRecording(cfg))
 
 	server := &http.Server{Addr: ":8080", Handler: nil}
 	go func() {
@@ -69,62 +91,43 @@ func main() {
 	fmt.Println("server exited cleanly")
 }
 
-// handleWebSocket manages WebSocket connections and streams Docker container commands.
-func handleWebSocket(ctx context.Context, cli *client.Client, w http.ResponseWriter, r *http.Request) {
-	if maxConnections <= 0 {
-		http.Error(w, "server is busy, please try again later", http.StatusServiceUnavailable)
-		return
-	}
-
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("failed to upgrade websocket: %v", err)
-		return
-	}
-	defer conn.Close()
-
-	maxConnections--
-	defer func() { maxConnections++ }()
-	activeSessions.Add(1)
-	defer activeSessions.Done()
-
-	containerID, err := startInteractiveContainer(ctx, cli)
-	if err != nil {
-		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("error starting container: %v", err)))
-		return
+// queryUint parses a positive integer query parameter, falling back to def
+// if the parameter is absent or invalid.
+func queryUint(r *http.Request, name string, def uint) uint {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def
 	}
-
-	defer func() {
-		stopAndRemoveContainer(ctx, cli, containerID)
-	}()
-
-	attachResp, err := cli.ContainerAttach(ctx, containerID,
-		container.AttachOptions{
-			Stream: true,
-			Stdin:  true,
-			Stdout: true,
-			Stderr: true,
-		})
-	if err != nil {
-		conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf("error attaching to container: %v", err)))
-		return
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		return def
 	}
-	defer attachResp.Close()
-
-	go readContainerOutput(conn, attachResp.Reader)
-	readWebSocketInput(conn, attachResp.Conn)
+	return uint(v)
 }
 
-// startInteractiveContainer creates and starts a Docker container with an interactive shell.
-func startInteractiveContainer(ctx context.Context, cli *client.Client) (string, error) {
-	cfg := &container.Config{
-		Image:     alpine,
-		Cmd:       []string{initialCmd},
+// startInteractiveContainer creates and starts a locked-down Docker container
+// running image, sized to the requested terminal dimensions.
+func startInteractiveContainer(ctx context.Context, cli *client.Client, cfg *Config, image string, cols, rows uint) (string, error) {
+	containerCfg := &container.Config{
+		Image:     image,
+		Cmd:       cfg.DefaultCmd,
 		Tty:       true,
 		OpenStdin: true,
 	}
+	hostCfg := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:    cfg.Resources.MemoryBytes,
+			NanoCPUs:  cfg.Resources.NanoCPUs,
+			PidsLimit: &cfg.Resources.PidsLimit,
+		},
+		CapDrop:        []string{"ALL"},
+		ReadonlyRootfs: true,
+		NetworkMode:    "none",
+		SecurityOpt:    []string{"no-new-privileges"},
+		Tmpfs:          map[string]string{"/tmp": "rw,noexec,nosuid,size=64m"},
+	}
 
-	resp, err := cli.ContainerCreate(ctx, cfg, nil, nil, nil, "")
+	resp, err := cli.ContainerCreate(ctx, containerCfg, hostCfg, nil, nil, "")
 	if err != nil {
 		return "", fmt.Errorf("error creating container: %w", err)
 	}
@@ -132,6 +135,11 @@ func startInteractiveContainer(ctx context.Context, cli *client.Client) (string,
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return "", fmt.Errorf("error starting container: %w", err)
 	}
+
+	if err := cli.ContainerResize(ctx, resp.ID, container.ResizeOptions{Width: cols, Height: rows}); err != nil {
+		log.Printf("error setting initial container size for %s: %v", resp.ID, err)
+	}
+
 	return resp.ID, nil
 }
 
@@ -145,37 +153,6 @@ func stopAndRemoveContainer(ctx context.Context, cli *client.Client, containerID
 	}
 }
 
-// readContainerOutput reads output from the container and sends it over WebSocket.
-func readContainerOutput(conn *websocket.Conn, reader io.Reader) {
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		if err := conn.WriteMessage(websocket.TextMessage, scanner.Bytes()); err != nil {
-			log.Printf("error writing to WebSocket: %v", err)
-			break
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("error reading container output: %v", err)
-	}
-}
-
-// readWebSocketInput reads input from WebSocket and sends it to the container.
-func readWebSocketInput(conn *websocket.Conn, containerStdin io.WriteCloser) {
-	defer containerStdin.Close()
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("websocket read error: %v", err)
-			break
-		}
-		_, err = containerStdin.Write(append(message, '\n'))
-		if err != nil {
-			log.Printf("error writing to container stdin: %v", err)
-			break
-		}
-	}
-}
-
 // initDockerClient initializes and returns a Docker client.
 func initDockerClient(ctx context.Context) (*client.Client, error) {
 	c, err := client.NewClientWithOpts(client.FromEnv)
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// asciicastHeader is the header line of an asciicast v2 recording.
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Env       map[string]string `json:"env"`
+}
+
+// recorder writes a session's terminal activity to an asciicast v2 file: a
+// header line followed by newline-delimited [elapsedSeconds, "o"|"i", data]
+// events, so any asciinema-compatible player can replay the session.
+type recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+}
+
+// newRecorder creates dir if needed, rotates old recordings out per
+// cfg.RecordingsRetention, and opens id.cast for writing.
+func newRecorder(cfg *Config, id string, cols, rows uint) (*recorder, error) {
+	if err := os.MkdirAll(cfg.RecordingsDir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating recordings dir: %w", err)
+	}
+	rotateRecordings(cfg)
+
+	f, err := os.Create(recordingPath(cfg, id))
+	if err != nil {
+		return nil, fmt.Errorf("error creating recording file: %w", err)
+	}
+
+	rec := &recorder{file: f, start: time.Now()}
+
+	shell := initialCmd
+	if len(cfg.DefaultCmd) > 0 {
+		shell = cfg.DefaultCmd[0]
+	}
+	header := asciicastHeader{
+		Version:   2,
+		Width:     int(cols),
+		Height:    int(rows),
+		Timestamp: rec.start.Unix(),
+		Env:       map[string]string{"SHELL": shell, "TERM": "xterm-256color"},
+	}
+	line, err := json.Marshal(header)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(f, "%s\n", line); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// recordOutput appends a stdout event.
+func (rec *recorder) recordOutput(data []byte) { rec.writeEvent("o", data) }
+
+// recordInput appends a stdin event.
+func (rec *recorder) recordInput(data []byte) { rec.writeEvent("i", data) }
+
+func (rec *recorder) writeEvent(kind string, data []byte) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.file == nil {
+		return
+	}
+	event := []any{time.Since(rec.start).Seconds(), kind, string(data)}
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("recorder: error encoding event: %v", err)
+		return
+	}
+	if _, err := fmt.Fprintf(rec.file, "%s\n", line); err != nil {
+		log.Printf("recorder: error writing event: %v", err)
+	}
+}
+
+// Close flushes and closes the recording file.
+func (rec *recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.file == nil {
+		return nil
+	}
+	err := rec.file.Close()
+	rec.file = nil
+	return err
+}
+
+func recordingPath(cfg *Config, id string) string {
+	return filepath.Join(cfg.RecordingsDir, id+".cast")
+}
+
+// rotateRecordings deletes the oldest recordings in cfg.RecordingsDir once
+// cfg.RecordingsRetention or more are present, keeping the newest
+// cfg.RecordingsRetention-1 so the recording about to be created brings the
+// total back to cfg.RecordingsRetention. A retention of 0 disables rotation.
+func rotateRecordings(cfg *Config) {
+	if cfg.RecordingsRetention <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(cfg.RecordingsDir)
+	if err != nil {
+		log.Printf("recorder: error listing recordings dir for rotation: %v", err)
+		return
+	}
+
+	var casts []os.DirEntry
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".cast") {
+			casts = append(casts, e)
+		}
+	}
+	if len(casts) < cfg.RecordingsRetention {
+		return
+	}
+
+	sort.Slice(casts, func(i, j int) bool {
+		ii, _ := casts[i].Info()
+		jj, _ := casts[j].Info()
+		return ii.ModTime().Before(jj.ModTime())
+	})
+
+	for _, e := range casts[:len(casts)-cfg.RecordingsRetention+1] {
+		path := filepath.Join(cfg.RecordingsDir, e.Name())
+		if err := os.Remove(path); err != nil {
+			log.Printf("recorder: error removing rotated recording %s: %v", path, err)
+		}
+	}
+}
+
+// handleListRecordings serves GET /recordings: a JSON array of recording IDs
+// available for replay.
+func handleListRecordings(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := os.ReadDir(cfg.RecordingsDir)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error listing recordings: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".cast") {
+				ids = append(ids, strings.TrimSuffix(e.Name(), ".cast"))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ids)
+	}
+}
+
+// handleGetRecording serves GET /recordings/{id}.cast, the raw asciicast
+// file for playback in any asciinema-compatible player.
+func handleGetRecording(cfg *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/recordings/")
+		if name == "" || strings.ContainsAny(name, "/\\") || !strings.HasSuffix(name, ".cast") {
+			http.Error(w, "invalid recording id", http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(cfg.RecordingsDir, name))
+	}
+}
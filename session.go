@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/websocket"
+)
+
+// broadcaster fans out container output to any number of subscribed
+// connWriters, à la moby's broadcastwriter. It lets several viewers share
+// one running session. Delivery goes through each subscriber's connWriter
+// rather than WriteMessage directly, so this never races with that
+// connection's ping/control writes.
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[*connWriter]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subs: make(map[*connWriter]struct{})}
+}
+
+func (b *broadcaster) Subscribe(cw *connWriter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[cw] = struct{}{}
+}
+
+func (b *broadcaster) Unsubscribe(cw *connWriter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, cw)
+}
+
+// Write implements io.Writer, queuing p as a binary frame for every
+// subscribed connection.
+func (b *broadcaster) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for cw := range b.subs {
+		cw.Send(websocket.BinaryMessage, p)
+	}
+	return len(p), nil
+}
+
+// Session ties a running container to a reconnectable session ID, decoupling
+// container lifetime from any single websocket connection.
+type Session struct {
+	ID          string
+	ContainerID string
+
+	mu           sync.Mutex
+	attach       types.HijackedResponse
+	broadcaster  *broadcaster
+	recorder     *recorder
+	startedAt    time.Time
+	lastActivity time.Time
+	viewers      int
+}
+
+// touch records activity on the session, postponing janitor reaping.
+func (s *Session) touch() {
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+}
+
+// writeStdin serializes writes to the container's stdin across viewers,
+// teeing each write to the session's recorder if one is active.
+func (s *Session) writeStdin(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recorder != nil {
+		s.recorder.recordInput(p)
+	}
+	return s.attach.Conn.Write(p)
+}
+
+// SessionManager keeps a registry of live sessions keyed by session ID and
+// reaps ones that have been idle, or alive, past the configured limits.
+type SessionManager struct {
+	ctx context.Context
+	cli *client.Client
+	cfg *Config
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// NewSessionManager starts a SessionManager and its background janitor. The
+// janitor stops when ctx is cancelled.
+func NewSessionManager(ctx context.Context, cli *client.Client, cfg *Config) *SessionManager {
+	m := &SessionManager{
+		ctx:      ctx,
+		cli:      cli,
+		cfg:      cfg,
+		sessions: make(map[string]*Session),
+	}
+	go m.janitor()
+	return m
+}
+
+// Get returns the session registered under id, if any.
+func (m *SessionManager) Get(id string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// Create starts a new container for image (or the configured default if
+// image is empty), attaches to it, and registers a session under a freshly
+// generated ID. cw, the creating connection's writer, is subscribed to the
+// session's broadcaster before the output pump starts so nothing emitted
+// right after the container starts (a shell banner, a prompt) is dropped
+// while waiting for a separate Join call.
+func (m *SessionManager) Create(image string, cols, rows uint, cw *connWriter) (*Session, error) {
+	if image == "" {
+		image = m.cfg.DefaultImage
+	}
+	if !m.cfg.allowsImage(image) {
+		return nil, fmt.Errorf("image %q is not in the allowed list", image)
+	}
+
+	containerID, err := startInteractiveContainer(m.ctx, m.cli, m.cfg, image, cols, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	attach, err := m.cli.ContainerAttach(m.ctx, containerID, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		stopAndRemoveContainer(m.ctx, m.cli, containerID)
+		return nil, fmt.Errorf("error attaching to container: %w", err)
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		attach.Close()
+		stopAndRemoveContainer(m.ctx, m.cli, containerID)
+		return nil, fmt.Errorf("error generating session id: %w", err)
+	}
+
+	s := &Session{
+		ID:           id,
+		ContainerID:  containerID,
+		attach:       attach,
+		broadcaster:  newBroadcaster(),
+		startedAt:    time.Now(),
+		lastActivity: time.Now(),
+	}
+
+	if m.cfg.RecordingsEnabled {
+		rec, err := newRecorder(m.cfg, id, cols, rows)
+		if err != nil {
+			log.Printf("session %s: recording disabled: %v", id, err)
+		} else {
+			s.recorder = rec
+		}
+	}
+
+	m.mu.Lock()
+	m.sessions[id] = s
+	m.mu.Unlock()
+
+	m.Join(s, cw)
+
+	out := io.Writer(s.broadcaster)
+	if s.recorder != nil {
+		out = io.MultiWriter(s.broadcaster, recorderOutputWriter{s.recorder})
+	}
+	go io.Copy(out, attach.Reader)
+
+	return s, nil
+}
+
+// Join attaches cw as a viewer of an existing session, subscribing it to the
+// session's broadcaster until it is removed with Leave.
+func (m *SessionManager) Join(s *Session, cw *connWriter) {
+	s.mu.Lock()
+	s.viewers++
+	s.mu.Unlock()
+	s.touch()
+	s.broadcaster.Subscribe(cw)
+}
+
+// Leave unsubscribes cw from the session. The underlying container is left
+// running until the janitor reaps it or the session has no viewers left for
+// longer than the TTL.
+func (m *SessionManager) Leave(s *Session, cw *connWriter) {
+	s.broadcaster.Unsubscribe(cw)
+	s.mu.Lock()
+	s.viewers--
+	s.mu.Unlock()
+	s.touch()
+}
+
+// Remove tears down the session's container and drops it from the registry.
+func (m *SessionManager) Remove(id string) {
+	m.mu.Lock()
+	s, ok := m.sessions[id]
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.attach.Close()
+	if s.recorder != nil {
+		if err := s.recorder.Close(); err != nil {
+			log.Printf("session %s: error closing recording: %v", id, err)
+		}
+	}
+	stopAndRemoveContainer(m.ctx, m.cli, s.ContainerID)
+}
+
+// recorderOutputWriter adapts a *recorder to io.Writer, recording each write
+// as a stdout event.
+type recorderOutputWriter struct {
+	rec *recorder
+}
+
+func (w recorderOutputWriter) Write(p []byte) (int, error) {
+	w.rec.recordOutput(p)
+	return len(p), nil
+}
+
+// janitor periodically reaps sessions that have had no viewers and no
+// activity for longer than the idle TTL, or that have run past the
+// configured max session duration regardless of activity. Either limit can
+// be disabled independently by setting it to <= 0; the janitor only stands
+// down entirely (rather than just ticking less often) when both are
+// disabled, since NewTicker panics on a non-positive interval and
+// reapExpired still needs to run for whichever limit remains active.
+func (m *SessionManager) janitor() {
+	interval := janitorInterval(m.cfg.SessionIdleTTL, m.cfg.MaxSessionDuration)
+	if interval <= 0 {
+		<-m.ctx.Done()
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.reapExpired()
+		}
+	}
+}
+
+// janitorInterval returns half of whichever of idleTTL/maxDuration is
+// smallest among the positive (enabled) ones, or 0 if neither is enabled.
+func janitorInterval(idleTTL, maxDuration time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, d := range []time.Duration{idleTTL, maxDuration} {
+		if d > 0 && (shortest == 0 || d < shortest) {
+			shortest = d
+		}
+	}
+	return shortest / 2
+}
+
+func (m *SessionManager) reapExpired() {
+	now := time.Now()
+	var expired []string
+
+	m.mu.Lock()
+	for id, s := range m.sessions {
+		s.mu.Lock()
+		idle := m.cfg.SessionIdleTTL > 0 && s.viewers == 0 && now.Sub(s.lastActivity) > m.cfg.SessionIdleTTL
+		overLifetime := m.cfg.MaxSessionDuration > 0 && now.Sub(s.startedAt) > m.cfg.MaxSessionDuration
+		s.mu.Unlock()
+		if idle || overLifetime {
+			expired = append(expired, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range expired {
+		log.Printf("session %s expired, reaping", id)
+		m.Remove(id)
+	}
+}
+
+// newSessionID generates a random hex session identifier.
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/gorilla/websocket"
+)
+
+// handleWebSocket manages WebSocket connections and streams Docker container
+// commands. ?mode=exec runs one-shot non-interactive commands with demuxed
+// stdout/stderr (see handleExecWebSocket); the default, mode=tty, is a full
+// interactive shell. A TTY client may join an existing session by passing
+// its ID via ?session=, or omit it to start a new one against ?image= (or
+// the configured default).
+func handleWebSocket(ctx context.Context, cli *client.Client, cfg *Config, sessions *SessionManager, limiter *ipLimiter, w http.ResponseWriter, r *http.Request) {
+	ip := clientIP(r, cfg.TrustProxyHeaders)
+	if !limiter.Acquire(ip) {
+		http.Error(w, "too many concurrent sessions for this client, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer limiter.Release(ip)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("failed to upgrade websocket: %v", err)
+		return
+	}
+
+	cw := newConnWriter(conn)
+	go cw.run()
+	defer cw.Close()
+
+	activeSessions.Add(1)
+	defer activeSessions.Done()
+
+	if r.URL.Query().Get("mode") == "exec" {
+		handleExecWebSocket(ctx, cli, cfg, conn, cw, r)
+		return
+	}
+
+	cols := queryUint(r, "cols", defaultCols)
+	rows := queryUint(r, "rows", defaultRows)
+
+	s, ok := sessions.Get(r.URL.Query().Get("session"))
+	if !ok {
+		// Create joins cw itself, before the container's output pump starts.
+		s, err = sessions.Create(r.URL.Query().Get("image"), cols, rows, cw)
+		if err != nil {
+			cw.Send(websocket.TextMessage, []byte(fmt.Sprintf("error starting container: %v", err)))
+			return
+		}
+	} else {
+		sessions.Join(s, cw)
+	}
+	defer sessions.Leave(s, cw)
+
+	sessionInfo, _ := json.Marshal(controlMessage{Type: "session", Data: s.ID})
+	cw.Send(websocket.TextMessage, sessionInfo)
+
+	readWebSocketInput(ctx, cli, s, conn)
+}
+
+// readWebSocketInput reads input from the WebSocket and forwards it to the
+// session's container. Binary frames are forwarded to stdin verbatim; text
+// frames are decoded as controlMessage JSON and dispatched by type ("input"
+// writes to stdin, "resize" calls ContainerResize).
+func readWebSocketInput(ctx context.Context, cli *client.Client, s *Session, conn *websocket.Conn) {
+	for {
+		msgType, message, err := conn.ReadMessage()
+		if err != nil {
+			log.Printf("websocket read error: %v", err)
+			return
+		}
+		s.touch()
+
+		switch msgType {
+		case websocket.BinaryMessage:
+			if _, err := s.writeStdin(message); err != nil {
+				log.Printf("error writing to container stdin: %v", err)
+				return
+			}
+		case websocket.TextMessage:
+			var ctrl controlMessage
+			if err := json.Unmarshal(message, &ctrl); err != nil {
+				log.Printf("error decoding control message: %v", err)
+				continue
+			}
+			if err := handleControlMessage(ctx, cli, s, ctrl); err != nil {
+				log.Printf("error handling control message: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// handleControlMessage dispatches a decoded controlMessage to its effect on
+// the session's container: "input" writes data to stdin, "resize" resizes
+// the container's TTY.
+func handleControlMessage(ctx context.Context, cli *client.Client, s *Session, ctrl controlMessage) error {
+	switch ctrl.Type {
+	case "input":
+		_, err := s.writeStdin([]byte(ctrl.Data))
+		return err
+	case "resize":
+		return cli.ContainerResize(ctx, s.ContainerID, container.ResizeOptions{Width: ctrl.Cols, Height: ctrl.Rows})
+	default:
+		log.Printf("unknown control message type: %q", ctrl.Type)
+		return nil
+	}
+}
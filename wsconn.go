@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// maxMessageSize caps the size of a single incoming WebSocket frame.
+	maxMessageSize = 1 << 20 // 1 MiB
+
+	// pongWait is how long we wait for a pong before considering the
+	// connection dead; only pongs refresh the read deadline.
+	pongWait = 60 * time.Second
+
+	// pingPeriod must be less than pongWait; it's how often we probe an
+	// otherwise-idle connection.
+	pingPeriod = (pongWait * 9) / 10
+
+	// writeWait bounds how long a single WriteMessage call may block.
+	writeWait = 10 * time.Second
+
+	// closeGracePeriod is how long we wait after sending a close frame
+	// before dropping the connection outright.
+	closeGracePeriod = 5 * time.Second
+
+	// sendBufferSize bounds how many frames may be queued for a slow
+	// client before the drop-oldest policy kicks in.
+	sendBufferSize = 256
+)
+
+type wsFrame struct {
+	msgType int
+	data    []byte
+}
+
+// connWriter serializes all writes to a *websocket.Conn through a single
+// goroutine, since gorilla/websocket forbids concurrent WriteMessage calls.
+// It also drives the ping/pong keepalive. Slow consumers have their oldest
+// queued frame dropped rather than blocking the rest of the server.
+type connWriter struct {
+	conn *websocket.Conn
+
+	send     chan wsFrame
+	closeErr chan struct{}
+	closeOne sync.Once
+}
+
+// newConnWriter configures conn's read side (size limit, pong deadline) and
+// returns a connWriter for its write side. Call run in its own goroutine.
+func newConnWriter(conn *websocket.Conn) *connWriter {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	return &connWriter{
+		conn:     conn,
+		send:     make(chan wsFrame, sendBufferSize),
+		closeErr: make(chan struct{}),
+	}
+}
+
+// Send queues a frame for delivery. If the queue is full, the oldest queued
+// frame is dropped to make room so a slow client can't back up the server.
+func (cw *connWriter) Send(msgType int, data []byte) {
+	frame := wsFrame{msgType: msgType, data: data}
+	select {
+	case cw.send <- frame:
+		return
+	default:
+	}
+
+	select {
+	case <-cw.send:
+	default:
+	}
+	select {
+	case cw.send <- frame:
+	default:
+		log.Printf("connWriter: dropping frame, send queue still full")
+	}
+}
+
+// Close requests a graceful shutdown: a close frame is sent, the writer
+// waits out closeGracePeriod for the peer to ack, and the connection is
+// closed. Safe to call more than once.
+func (cw *connWriter) Close() {
+	cw.closeOne.Do(func() { close(cw.closeErr) })
+}
+
+// run is the single goroutine permitted to call conn.WriteMessage. It
+// drains queued frames, pings idle connections, and closes the connection
+// on request or on first write error.
+func (cw *connWriter) run() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	defer cw.conn.Close()
+
+	for {
+		select {
+		case frame := <-cw.send:
+			cw.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cw.conn.WriteMessage(frame.msgType, frame.data); err != nil {
+				log.Printf("websocket write error: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			cw.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := cw.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("websocket ping error: %v", err)
+				return
+			}
+
+		case <-cw.closeErr:
+			cw.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			cw.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			time.Sleep(closeGracePeriod)
+			return
+		}
+	}
+}